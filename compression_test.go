@@ -0,0 +1,61 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dragonboat
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	pb "github.com/lni/dragonboat/v3/raftpb"
+)
+
+func TestZstdCompressorRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte("dragonboat zstd snapshot payload"), 1024)
+	var buf bytes.Buffer
+	w, err := newCompressor(pb.Zstd, 3, &buf)
+	if err != nil {
+		t.Fatalf("newCompressor failed: %v", err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	r, err := newDecompressor(pb.Zstd, &buf)
+	if err != nil {
+		t.Fatalf("newDecompressor failed: %v", err)
+	}
+	defer r.Close()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("round trip mismatch, got %d bytes want %d bytes", len(got), len(payload))
+	}
+}
+
+func TestUnsupportedCompressionTypesReturnErrIncompatibleData(t *testing.T) {
+	for _, ct := range []pb.CompressionType{pb.LZ4, pb.S2} {
+		if _, err := newCompressor(ct, 0, &bytes.Buffer{}); err != ErrIncompatibleData {
+			t.Errorf("newCompressor(%v) = %v, want ErrIncompatibleData", ct, err)
+		}
+	}
+	if _, err := newDecompressor(pb.CompressionType(99), bytes.NewReader(nil)); err != ErrIncompatibleData {
+		t.Errorf("newDecompressor(unknown) = %v, want ErrIncompatibleData", err)
+	}
+}
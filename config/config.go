@@ -0,0 +1,218 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config contains functions and types used for managing the
+// configurations of NodeHost and Raft clusters.
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"github.com/lni/dragonboat/v3/internal/objectstore"
+	"github.com/lni/dragonboat/v3/raftpb"
+)
+
+// NodeHostConfig is used to configure NodeHost instances.
+type NodeHostConfig struct {
+	// DeploymentID is used to determine whether two NodeHost instances
+	// belong to the same deployment and thus allowed to communicate with
+	// each other.
+	DeploymentID uint64
+	// WALDir is the directory used to store the write-ahead log of Raft
+	// entries.
+	WALDir string
+	// NodeHostDir is the directory used to store all remaining data other
+	// than the WAL.
+	NodeHostDir string
+	// RTTMillisecond is the average round trip time between two NodeHost
+	// instances, it is used to derive the Raft heartbeat/election timeouts.
+	RTTMillisecond uint64
+	// RaftAddress is the address used to identify this NodeHost instance
+	// and by which other NodeHost instances connect to it.
+	RaftAddress string
+	// MutualTLS enables mutual TLS authentication between NodeHost
+	// instances, reused by the admin HTTP endpoint when
+	// AdminListenAddress is set.
+	MutualTLS bool
+	CertFile  string
+	KeyFile   string
+	CAFile    string
+
+	// SnapshotStorage, when set, is the remote object store used to hold
+	// exported snapshots in addition to, or instead of, keeping them under
+	// the local path given in an export request. Typical implementations
+	// are objectstore.LocalFS and objectstore.S3Store.
+	SnapshotStorage objectstore.Store
+	// SnapshotStoragePrefixValue is the prefix under which exported
+	// snapshots are stored in SnapshotStorage. Use SnapshotStoragePrefix to
+	// read it with its documented "exported" default applied.
+	SnapshotStoragePrefixValue string
+
+	// AdminListenAddress, when set, is the address NodeHost starts its
+	// optional admin HTTP server on, exposing the snapshot lifecycle
+	// operations implemented by adminServer. Leaving it empty disables the
+	// admin server entirely.
+	AdminListenAddress string
+	// AdminAuthToken, when set together with AdminListenAddress, is the
+	// bearer token every admin HTTP request must present.
+	AdminAuthToken string
+
+	// SnapshotRetention configures which snapshots a Raft node's Compact
+	// call is allowed to remove. The zero value keeps the previous
+	// hard-coded behaviour of retaining a fixed number of most recent
+	// snapshots.
+	SnapshotRetention RetentionPolicy
+
+	// MaxSendQueueSize is the soft limit, in bytes, of the outgoing
+	// message queue kept for each remote NodeHost this instance's
+	// transport talks to. Once exceeded, further messages destined for
+	// that remote NodeHost are dropped rather than queued. 0 means
+	// unlimited.
+	MaxSendQueueSize uint64
+	// MaxReceiveQueueSize is the soft limit, in bytes, of the incoming
+	// message queue kept for each remote NodeHost this instance's
+	// transport receives from. 0 means unlimited.
+	MaxReceiveQueueSize uint64
+	// NotifyCommit, when enabled, lets a client wait for a proposal to be
+	// committed without also waiting for it to be applied, by passing
+	// WithNotifyCommit to the relevant NodeHost request.
+	NotifyCommit bool
+
+	// RaftRPCFactory creates the raftio.IRaftRPC transport instance used
+	// by NodeHost to exchange Raft messages with remote NodeHost
+	// instances. Defaults to the built-in TCP based transport when left
+	// nil.
+	RaftRPCFactory RaftRPCFactoryFunc
+
+	// Expert holds settings most users should leave at their zero value;
+	// they exist for advanced tuning and internal testing rather than
+	// everyday configuration.
+	Expert ExpertConfig
+}
+
+// RaftRPCFactoryFunc creates a raftio.IRaftRPC transport for a NodeHost,
+// given its NodeHostConfig. It is the type of NodeHostConfig.RaftRPCFactory.
+type RaftRPCFactoryFunc func(NodeHostConfig) interface{}
+
+// ExpertConfig groups the advanced, rarely touched settings that exist for
+// tuning and internal testing rather than everyday configuration. Each
+// field's zero value selects the package's normal default behaviour.
+type ExpertConfig struct {
+	// ExecEngine configures the execution engine that applies committed
+	// Raft log entries to each cluster's state machine.
+	ExecEngine ExecEngineConfig
+	// LogDB configures the LogDB implementation constructed for the
+	// NodeHost when no custom one is supplied.
+	LogDB LogDBConfig
+}
+
+// ExecEngineConfig tunes the worker pools used by the execution engine that
+// applies committed Raft log entries and takes snapshots.
+type ExecEngineConfig struct {
+	// ExecShards is the number of workers used to apply committed entries
+	// to state machines. 0 selects the package default.
+	ExecShards uint64
+	// CommitShards is the number of workers used to save snapshots. 0
+	// selects the package default.
+	CommitShards uint64
+}
+
+// LogDBConfig tunes the default LogDB implementation's on disk layout and
+// background compaction behaviour.
+type LogDBConfig struct {
+	// Shards is the number of parallel LogDB shards used to spread Raft
+	// log I/O across. 0 selects the package default.
+	Shards uint64
+	// KVMaxBackgroundCompactions is the max number of concurrent
+	// background compactions the underlying KV store may run. 0 selects
+	// the store's own default.
+	KVMaxBackgroundCompactions int
+}
+
+// RetentionPolicy configures how a Raft node decides which of its
+// snapshots to remove during compaction. It lives in this package, rather
+// than next to the compaction code that consumes it, so it can be
+// referenced from NodeHostConfig.SnapshotRetention. Pinned snapshots, see
+// raftpb.Snapshot.Pinned, are never removed by any of these rules.
+type RetentionPolicy struct {
+	// KeepLast is the number of most recent snapshots to always keep,
+	// regardless of tags. A zero value lets the caller fall back to its
+	// own default (snapshotsToKeep, for dragonboat.selectSnapshotsToCompact).
+	KeepLast int
+	// KeepPerTag, when non-empty, keeps the given number of most recent
+	// snapshots carrying each tag key listed, whatever the tag's value,
+	// e.g. {"nightly": 30} keeps the
+	// last 30 snapshots tagged "nightly" even if KeepLast would otherwise
+	// have removed them.
+	KeepPerTag map[string]int
+	// KeepWithin, when non-zero, keeps every snapshot taken within the
+	// given duration of now, in addition to whatever KeepLast/KeepPerTag
+	// already keep.
+	KeepWithin time.Duration
+}
+
+// SnapshotStoragePrefix returns the prefix under which exported snapshots
+// are stored in SnapshotStorage, defaulting to "exported" when unset.
+func (c *NodeHostConfig) SnapshotStoragePrefix() string {
+	if len(c.SnapshotStoragePrefixValue) == 0 {
+		return "exported"
+	}
+	return c.SnapshotStoragePrefixValue
+}
+
+// GetServerTLSConfig returns the *tls.Config to be used by the admin HTTP
+// server when MutualTLS is enabled, loaded from CertFile/KeyFile/CAFile.
+func (c *NodeHostConfig) GetServerTLSConfig() (*tls.Config, error) {
+	if !c.MutualTLS {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := ioutil.ReadFile(c.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("invalid CA certificate")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}, nil
+}
+
+// Config is used to configure a Raft node running on a NodeHost.
+type Config struct {
+	// ClusterID is the unique identifier of the Raft cluster.
+	ClusterID uint64
+	// NodeID is the unique identifier of the node within its Raft cluster.
+	NodeID uint64
+	// SnapshotCompressionType determines the compression algorithm used on
+	// the node's snapshot payloads, see raftpb.CompressionType. Defaults to
+	// raftpb.Snappy when left as the zero value.
+	SnapshotCompressionType raftpb.CompressionType
+	// SnapshotCompressionLevel controls the space/CPU trade off made by
+	// compression algorithms that support multiple levels, currently only
+	// raftpb.Zstd. It is on a 1-9 scale, 1 being fastest and 9 being the
+	// smallest output; 0 uses the algorithm's own default.
+	SnapshotCompressionLevel int
+}
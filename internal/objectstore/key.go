@@ -0,0 +1,52 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"fmt"
+	"path"
+)
+
+const metadataSuffix = ".metadata"
+const pendingSuffix = ".pending"
+
+// indexWidth is wide enough for any uint64 index printed in decimal, so
+// that zero-padded keys keep sorting lexicographically in the same order
+// as their numeric index - List/Compact rely on that to tell oldest from
+// newest.
+const indexWidth = 20
+
+func snapshotKey(prefix string, clusterID uint64, nodeID uint64, index uint64) string {
+	name := fmt.Sprintf("%0*d-%0*d.snap", indexWidth, nodeID, indexWidth, index)
+	return path.Join(prefix, fmt.Sprintf("%d", clusterID), name)
+}
+
+// NodePrefix returns the key prefix shared by every snapshot object
+// belonging to clusterID/nodeID under prefix. Callers that need to apply a
+// per-node retention policy should filter List's results (which are only
+// scoped to a directory, not a filename prefix) with strings.HasPrefix
+// against this value, since nodes sharing a cluster also share the same
+// "<prefix>/<clusterID>" listing directory.
+func NodePrefix(prefix string, clusterID uint64, nodeID uint64) string {
+	return path.Join(prefix, fmt.Sprintf("%d", clusterID), fmt.Sprintf("%0*d-", indexWidth, nodeID))
+}
+
+func metadataKey(key string) string {
+	return key + metadataSuffix
+}
+
+func pendingKey(key string) string {
+	return key + pendingSuffix
+}
@@ -0,0 +1,50 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestSnapshotKeysSortInIndexOrderPastTenEntries(t *testing.T) {
+	var keys []string
+	for i := uint64(1); i <= 12; i++ {
+		keys = append(keys, snapshotKey("exported", 1, 1, i))
+	}
+	shuffled := make([]string, len(keys))
+	copy(shuffled, keys)
+	sort.Strings(shuffled)
+	if len(shuffled) != len(keys) {
+		t.Fatalf("unexpected key count")
+	}
+	for i := range keys {
+		if shuffled[i] != keys[i] {
+			t.Fatalf("keys do not sort in index order: got %v, want %v", shuffled, keys)
+		}
+	}
+}
+
+func TestNodePrefixOnlyMatchesOwnNode(t *testing.T) {
+	node1Key := snapshotKey("exported", 1, 1, 5)
+	node11Key := snapshotKey("exported", 1, 11, 5)
+	prefix := NodePrefix("exported", 1, 1)
+	if len(node1Key) < len(prefix) || node1Key[:len(prefix)] != prefix {
+		t.Fatalf("expected %q to have prefix %q", node1Key, prefix)
+	}
+	if len(node11Key) >= len(prefix) && node11Key[:len(prefix)] == prefix {
+		t.Fatalf("node 11's key %q must not match node 1's prefix %q", node11Key, prefix)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// LocalFS is a Store backed by a directory on the local filesystem. It is
+// mainly intended as the default, zero-configuration backend and as a
+// drop-in replacement for the S3 backend in tests.
+type LocalFS struct {
+	RootDir string
+}
+
+var _ Store = (*LocalFS)(nil)
+
+// NewLocalFS creates a LocalFS store rooted at rootDir. rootDir is created
+// on first use if it does not already exist.
+func NewLocalFS(rootDir string) *LocalFS {
+	return &LocalFS{RootDir: rootDir}
+}
+
+func (fs *LocalFS) path(key string) string {
+	return filepath.Join(fs.RootDir, filepath.FromSlash(key))
+}
+
+// Put implements Store.
+func (fs *LocalFS) Put(ctx context.Context,
+	key string, r io.Reader, meta Metadata) (err error) {
+	fp := fs.path(key)
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return err
+	}
+	pendingFp := fs.path(pendingKey(key))
+	f, err := os.Create(pendingFp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	pendingMetaFp := fs.path(pendingKey(metadataKey(key)))
+	if err := ioutil.WriteFile(pendingMetaFp, data, 0644); err != nil {
+		return err
+	}
+	// Stage the metadata document through the same pending/rename sequence
+	// as the payload so a concurrent Get never observes a half written
+	// metadata document. The metadata is promoted first; a Get that runs
+	// between the two renames finds the metadata but no payload and
+	// returns ErrObjectNotFound.
+	if err := os.Rename(pendingMetaFp, fs.path(metadataKey(key))); err != nil {
+		return err
+	}
+	return os.Rename(pendingFp, fp)
+}
+
+// Get implements Store.
+func (fs *LocalFS) Get(ctx context.Context,
+	key string) (io.ReadCloser, Metadata, error) {
+	var meta Metadata
+	data, err := ioutil.ReadFile(fs.path(metadataKey(key)))
+	if os.IsNotExist(err) {
+		return nil, meta, ErrObjectNotFound
+	} else if err != nil {
+		return nil, meta, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, meta, err
+	}
+	f, err := os.Open(fs.path(key))
+	if os.IsNotExist(err) {
+		return nil, meta, ErrObjectNotFound
+	} else if err != nil {
+		return nil, meta, err
+	}
+	return f, meta, nil
+}
+
+// List implements Store.
+func (fs *LocalFS) List(ctx context.Context, prefix string) ([]string, error) {
+	dir := fs.path(prefix)
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".snap" {
+			continue
+		}
+		keys = append(keys, filepath.ToSlash(filepath.Join(prefix, e.Name())))
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Delete implements Store.
+func (fs *LocalFS) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(fs.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(fs.path(metadataKey(key))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLocalFSPutGetDeleteRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "objectstore-local-test")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewLocalFS(dir)
+	key := snapshotKey("exported", 1, 1, 5)
+	meta := Metadata{ClusterID: 1, NodeID: 1, Index: 5}
+	if err := store.Put(context.Background(), key, bytes.NewReader([]byte("payload")), meta); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	r, gotMeta, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if string(data) != "payload" {
+		t.Errorf("unexpected payload %q", data)
+	}
+	if gotMeta.Index != meta.Index {
+		t.Errorf("unexpected metadata %+v", gotMeta)
+	}
+	if err := store.Delete(context.Background(), key); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, _, err := store.Get(context.Background(), key); err != ErrObjectNotFound {
+		t.Fatalf("expected ErrObjectNotFound after delete, got %v", err)
+	}
+}
+
+func TestLocalFSListReturnsIndexOrderPastTenEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "objectstore-local-test")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewLocalFS(dir)
+	for i := uint64(1); i <= 12; i++ {
+		key := snapshotKey("exported", 1, 1, i)
+		meta := Metadata{ClusterID: 1, NodeID: 1, Index: i}
+		if err := store.Put(context.Background(),
+			key, bytes.NewReader([]byte("x")), meta); err != nil {
+			t.Fatalf("put %d failed: %v", i, err)
+		}
+	}
+	keys, err := store.List(context.Background(), "exported/1")
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(keys) != 12 {
+		t.Fatalf("expected 12 keys, got %d", len(keys))
+	}
+	want := snapshotKey("exported", 1, 1, 1)
+	if keys[0] != want {
+		t.Fatalf("expected oldest snapshot %q first, got %q - retention would delete the wrong ones", want, keys[0])
+	}
+	want = snapshotKey("exported", 1, 1, 12)
+	if keys[len(keys)-1] != want {
+		t.Fatalf("expected newest snapshot %q last, got %q", want, keys[len(keys)-1])
+	}
+}
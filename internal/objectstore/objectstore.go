@@ -0,0 +1,72 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package objectstore provides the pluggable remote storage backends used
+// to offload exported snapshots to an object store, e.g. an S3-compatible
+// endpoint, rather than keeping them on the local filesystem that produced
+// them.
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrObjectNotFound is returned when the requested remote object does not
+// exist in the configured store.
+var ErrObjectNotFound = errors.New("object not found in remote store")
+
+// Metadata is the sidecar JSON document uploaded next to every remote
+// snapshot object. It carries just enough information to validate and
+// import the snapshot without first downloading the (potentially large)
+// payload.
+type Metadata struct {
+	ClusterID       uint64            `json:"clusterId"`
+	NodeID          uint64            `json:"nodeId"`
+	Index           uint64            `json:"index"`
+	Term            uint64            `json:"term"`
+	Membership      []byte            `json:"membership"`
+	Checksum        []byte            `json:"checksum"`
+	FileSize        uint64            `json:"fileSize"`
+	CompressionType uint32            `json:"compressionType"`
+}
+
+// Store is the interface implemented by every remote snapshot storage
+// backend. Callers are the snapshotter (on upload/compact) and nodehost
+// (on import). Keys are always of the form
+// "<prefix>/<clusterID>/<nodeID>-<index>.snap" for the payload, with the
+// metadata document stored under the same key plus a ".metadata" suffix.
+type Store interface {
+	// Put uploads the content read from r under key, first writing it to a
+	// "<key>.pending" object and atomically renaming it to key once the
+	// upload completes, so that a reader never observes a partially
+	// written object.
+	Put(ctx context.Context, key string, r io.Reader, meta Metadata) error
+	// Get opens the object stored under key for reading. The caller is
+	// responsible for closing the returned reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, Metadata, error)
+	// List returns the keys of every snapshot object stored under prefix,
+	// ordered from oldest to newest.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete removes the object (and its metadata sidecar) stored under
+	// key. Deleting a key that does not exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Key returns the remote object key used for the exported snapshot taken by
+// the given cluster/node at index, rooted at prefix.
+func Key(prefix string, clusterID uint64, nodeID uint64, index uint64) string {
+	return snapshotKey(prefix, clusterID, nodeID, index)
+}
@@ -0,0 +1,249 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// CredentialProvider resolves the access key/secret used to talk to the
+// object store. It mirrors aws.CredentialsProvider but is kept as a
+// dragonboat owned type so non-S3 backends are not forced to pull in the
+// AWS SDK.
+type CredentialProvider interface {
+	Retrieve() (accessKeyID string, secretAccessKey string, err error)
+}
+
+// S3Config holds the endpoint-specific settings needed to talk to an
+// S3-compatible object store. Callers that want the S3 backend rather than
+// the local FS one pass it to NewS3Store and assign the result to
+// config.NodeHostConfig.SnapshotStorage.
+type S3Config struct {
+	// Endpoint is the S3-compatible HTTP(S) endpoint, e.g.
+	// "https://s3.us-east-1.amazonaws.com" or a MinIO address.
+	Endpoint string
+	// Region is the region passed to the SDK, required by some
+	// S3-compatible services even when Endpoint already pins the region.
+	Region string
+	// Bucket is the destination bucket for exported snapshots.
+	Bucket string
+	// Prefix is stored on the S3Store but not applied by it: Put, Get, List
+	// and Delete use the keys they are given as is, and those keys are
+	// rooted at config.NodeHostConfig.SnapshotStoragePrefix instead.
+	Prefix string
+	// Credentials resolves the access key/secret pair used to sign
+	// requests. When nil, the SDK's default credential chain is used.
+	Credentials CredentialProvider
+	// TLSConfig, when set, is used verbatim for the HTTPS connection to
+	// Endpoint. CACertFile is only consulted when TLSConfig is nil.
+	TLSConfig *tls.Config
+	// CACertFile is an optional path to a PEM encoded CA bundle used to
+	// verify Endpoint's certificate when TLSConfig is not set.
+	CACertFile string
+}
+
+// S3Store is a Store implementation backed by an S3-compatible endpoint.
+type S3Store struct {
+	cfg    S3Config
+	client *s3.S3
+}
+
+var _ Store = (*S3Store)(nil)
+
+// NewS3Store creates a S3Store using cfg.
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	awsCfg := aws.NewConfig().
+		WithEndpoint(cfg.Endpoint).
+		WithRegion(cfg.Region).
+		WithHTTPClient(httpClient).
+		WithS3ForcePathStyle(true)
+	if cfg.Credentials != nil {
+		accessKeyID, secretAccessKey, err := cfg.Credentials.Retrieve()
+		if err != nil {
+			return nil, err
+		}
+		awsCfg = awsCfg.WithCredentials(
+			credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""))
+	}
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Store{cfg: cfg, client: s3.New(sess)}, nil
+}
+
+func newHTTPClient(cfg S3Config) (*http.Client, error) {
+	if cfg.TLSConfig != nil {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg.TLSConfig}}, nil
+	}
+	if len(cfg.CACertFile) == 0 {
+		return http.DefaultClient, nil
+	}
+	pem, err := ioutil.ReadFile(cfg.CACertFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errInvalidCACert
+	}
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}, nil
+}
+
+// Put implements Store.
+func (st *S3Store) Put(ctx context.Context,
+	key string, r io.Reader, meta Metadata) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	pendingPayloadKey := pendingKey(key)
+	pendingMetaKey := pendingKey(metadataKey(key))
+	body, ok := r.(io.ReadSeeker)
+	if !ok {
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		body = newBytesReadSeeker(buf)
+	}
+	if _, err := st.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(st.cfg.Bucket),
+		Key:    aws.String(pendingPayloadKey),
+		Body:   body,
+	}); err != nil {
+		return err
+	}
+	if _, err := st.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(st.cfg.Bucket),
+		Key:    aws.String(pendingMetaKey),
+		Body:   newBytesReadSeeker(data),
+	}); err != nil {
+		return err
+	}
+	// S3 has no atomic rename, emulate it with a server side copy followed
+	// by a delete of each staged object. The metadata document is promoted
+	// first so that, once this returns successfully, the only remaining
+	// race a concurrent Get can observe is "metadata exists, payload
+	// doesn't yet" - which Get already handles by surfacing
+	// ErrObjectNotFound for the payload - rather than a metadata document
+	// that was only ever partially written.
+	if err := st.promote(ctx, pendingMetaKey, metadataKey(key)); err != nil {
+		return err
+	}
+	return st.promote(ctx, pendingPayloadKey, key)
+}
+
+// promote copies the object staged under pendingKey to finalKey and then
+// removes the staged copy, the closest S3 can get to an atomic rename.
+func (st *S3Store) promote(ctx context.Context, pendingKey string, finalKey string) error {
+	if _, err := st.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(st.cfg.Bucket),
+		CopySource: aws.String(st.cfg.Bucket + "/" + pendingKey),
+		Key:        aws.String(finalKey),
+	}); err != nil {
+		return err
+	}
+	_, err := st.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(st.cfg.Bucket),
+		Key:    aws.String(pendingKey),
+	})
+	return err
+}
+
+// Get implements Store.
+func (st *S3Store) Get(ctx context.Context,
+	key string) (io.ReadCloser, Metadata, error) {
+	var meta Metadata
+	metaOut, err := st.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(st.cfg.Bucket),
+		Key:    aws.String(metadataKey(key)),
+	})
+	if isNotFound(err) {
+		return nil, meta, ErrObjectNotFound
+	} else if err != nil {
+		return nil, meta, err
+	}
+	defer metaOut.Body.Close()
+	data, err := ioutil.ReadAll(metaOut.Body)
+	if err != nil {
+		return nil, meta, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, meta, err
+	}
+	out, err := st.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(st.cfg.Bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return nil, meta, ErrObjectNotFound
+	} else if err != nil {
+		return nil, meta, err
+	}
+	return out.Body, meta, nil
+}
+
+// List implements Store.
+func (st *S3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := st.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(st.cfg.Bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			k := aws.StringValue(obj.Key)
+			if len(k) > len(metadataSuffix) && k[len(k)-len(metadataSuffix):] == metadataSuffix {
+				continue
+			}
+			if len(k) > len(pendingSuffix) && k[len(k)-len(pendingSuffix):] == pendingSuffix {
+				continue
+			}
+			keys = append(keys, k)
+		}
+		return true
+	})
+	return keys, err
+}
+
+// Delete implements Store.
+func (st *S3Store) Delete(ctx context.Context, key string) error {
+	for _, k := range []string{key, metadataKey(key)} {
+		if _, err := st.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(st.cfg.Bucket),
+			Key:    aws.String(k),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rsm implements the replicated state machine layer sitting
+// between a Raft log and the pluggable statemachine.IStateMachine used by
+// an application, including the on disk snapshot format used by
+// snapshotter.
+package rsm
+
+import (
+	"context"
+	"io"
+
+	pb "github.com/lni/dragonboat/v3/raftpb"
+	sm "github.com/lni/dragonboat/v3/statemachine"
+)
+
+// SSVersion is the version number of the on disk snapshot file format.
+type SSVersion uint64
+
+// SnapshotVersion is the snapshot file format version produced by this
+// binary.
+const SnapshotVersion SSVersion = 2
+
+// SnapshotHeaderSize is the fixed size, in bytes, reserved at the start of
+// every snapshot file for its Header, written by SnapshotWriter and read
+// back by SnapshotReader.GetHeader.
+const SnapshotHeaderSize = 1024
+
+// ISession is the interface implemented by the client session tracker
+// passed to Stream/Save as part of SSMeta, used to persist in-flight
+// session state alongside the state machine's own data.
+type ISession interface {
+	// Bytes returns the binary representation of the session state to be
+	// written into the snapshot ahead of the state machine's own payload.
+	Bytes() []byte
+}
+
+// SSRequest describes how a snapshot was requested, e.g. through
+// NodeHost.SyncRequestSnapshot's SnapshotOption.
+type SSRequest struct {
+	// Exported indicates that the snapshot is an exported snapshot written
+	// to Path rather than saved as a regular snapshot managed by the LogDB.
+	Exported bool
+	// Path is the target directory for an exported snapshot. Required when
+	// Exported is set.
+	Path string
+	// OverrideCompaction, when set, allows the snapshot to be requested
+	// even if CompactionOverhead would normally suppress it.
+	OverrideCompaction bool
+	// CompactionOverhead overrides the cluster's configured compaction
+	// overhead for this request only.
+	CompactionOverhead uint64
+	// Tags carries the operator supplied labels to attach to the resulting
+	// pb.Snapshot, consumed by SnapshotFilter and RetentionPolicy.KeepPerTag.
+	Tags map[string]string
+	// Pinned marks the resulting pb.Snapshot as exempt from compaction.
+	Pinned bool
+}
+
+// IsExportedSnapshot returns a boolean flag indicating whether the request
+// is for an exported snapshot.
+func (r SSRequest) IsExportedSnapshot() bool {
+	return r.Exported
+}
+
+// SSMeta is the metadata describing a snapshot currently being generated,
+// threaded through Stream/Save/PrepareSnapshot.
+type SSMeta struct {
+	Index       uint64
+	Term        uint64
+	OnDiskIndex uint64
+	// CompressionType is the only source of truth for which algorithm the
+	// snapshot payload is compressed with; it drives both the
+	// rsm.SnapshotWriter/newCompressor pair that actually write the
+	// payload and, via snapshotter.Save, the pb.Snapshot.Type persisted
+	// alongside it, so the two can never disagree.
+	CompressionType  pb.CompressionType
+	CompressionLevel int
+	Membership       pb.Membership
+	Request          SSRequest
+	Ctx              context.Context
+	Session          ISession
+}
+
+// ISavable is implemented by the state machine wrapper types that know how
+// to serialize their own state into a snapshot payload.
+type ISavable interface {
+	// SaveSnapshot writes the state machine's state to w, returning whether
+	// the resulting snapshot is a dummy (empty) one.
+	SaveSnapshot(meta *SSMeta, w io.Writer,
+		session []byte, files *FileCollection) (bool, error)
+}
+
+// IStreamable is implemented by the state machine wrapper types that
+// support streaming their state directly to a remote node rather than
+// going through an on disk snapshot file first.
+type IStreamable interface {
+	// StreamSnapshot writes the state machine's state to w.
+	StreamSnapshot(ctx context.Context, w io.Writer) error
+}
+
+// ILoadableSessions is implemented by the client session tracker that
+// knows how to restore itself from a snapshot payload.
+type ILoadableSessions interface {
+	// LoadSessions restores session state from r, a snapshot written using
+	// the given format version.
+	LoadSessions(r io.Reader, v SSVersion) error
+}
+
+// ILoadableSM is implemented by the state machine wrapper types that know
+// how to restore their own state from a snapshot payload.
+type ILoadableSM interface {
+	// RecoverFromSnapshot restores the state machine's state from r, given
+	// the external files, if any, recorded alongside the snapshot.
+	RecoverFromSnapshot(r io.Reader, fs []sm.SnapshotFile) error
+}
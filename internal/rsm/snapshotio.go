@@ -0,0 +1,268 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	pb "github.com/lni/dragonboat/v3/raftpb"
+	"github.com/lni/goutils/fileutil"
+)
+
+// Header is the metadata recorded in the fixed size SnapshotHeaderSize
+// region at the start of every snapshot file.
+type Header struct {
+	Version         SSVersion
+	CompressionType pb.CompressionType
+	PayloadChecksum []byte
+	PayloadSize     uint64
+}
+
+// SnapshotWriter writes a snapshot's payload to its on disk file, leaving
+// room for a Header that can only be computed once the whole payload,
+// e.g. its checksum, is known. The header is filled in and flushed to disk
+// when GetPayloadSize is called, which Save always does last.
+type SnapshotWriter struct {
+	f         *os.File
+	version   SSVersion
+	ct        pb.CompressionType
+	hasher    hash.Hash32
+	written   uint64
+	finalized bool
+}
+
+// NewSnapshotWriter creates a SnapshotWriter that writes the snapshot
+// payload, compressed using ct/level, to fp.
+func NewSnapshotWriter(fp string,
+	version SSVersion, ct pb.CompressionType, level int) (*SnapshotWriter, error) {
+	f, err := os.Create(fp)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(make([]byte, SnapshotHeaderSize)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &SnapshotWriter{
+		f:       f,
+		version: version,
+		ct:      ct,
+		hasher:  crc32.NewIEEE(),
+	}, nil
+}
+
+// Write implements io.Writer, writing the already compressed payload chunk
+// in data to the underlying file while updating the running checksum.
+func (w *SnapshotWriter) Write(data []byte) (int, error) {
+	n, err := w.f.Write(data)
+	if n > 0 {
+		w.hasher.Write(data[:n])
+		w.written += uint64(n)
+	}
+	return n, err
+}
+
+// GetPayloadChecksum returns the crc32 checksum of every byte written to
+// the snapshot file's payload region so far.
+func (w *SnapshotWriter) GetPayloadChecksum() []byte {
+	return w.hasher.Sum(nil)
+}
+
+// GetPayloadSize returns total, the number of payload bytes written. As a
+// side effect, it finalizes the file by writing its Header to the
+// reserved header region and closing it - Save always calls this last,
+// once the checksum and size it needs are both known.
+func (w *SnapshotWriter) GetPayloadSize(total uint64) uint64 {
+	if !w.finalized {
+		w.finalized = true
+		h := Header{
+			Version:         w.version,
+			CompressionType: w.ct,
+			PayloadChecksum: w.GetPayloadChecksum(),
+			PayloadSize:     w.written,
+		}
+		if data, err := json.Marshal(h); err == nil && len(data) <= SnapshotHeaderSize {
+			buf := make([]byte, SnapshotHeaderSize)
+			copy(buf, data)
+			w.f.WriteAt(buf, 0)
+		}
+		w.f.Sync()
+		w.f.Close()
+	}
+	return total
+}
+
+// SnapshotReader reads a snapshot file previously written by
+// SnapshotWriter, tracking a running checksum of the payload bytes as they
+// are read so ValidatePayload can be used once the payload has been fully
+// consumed.
+type SnapshotReader struct {
+	f      *os.File
+	hasher hash.Hash32
+}
+
+// NewSnapshotReader opens the snapshot file at fp for reading.
+func NewSnapshotReader(fp string) (*SnapshotReader, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotReader{f: f, hasher: crc32.NewIEEE()}, nil
+}
+
+// GetHeader reads and returns the snapshot's Header, leaving the file
+// positioned at the start of the payload.
+func (r *SnapshotReader) GetHeader() (Header, error) {
+	buf := make([]byte, SnapshotHeaderSize)
+	if _, err := io.ReadFull(r.f, buf); err != nil {
+		return Header{}, err
+	}
+	var h Header
+	if err := json.Unmarshal(bytes.TrimRight(buf, "\x00"), &h); err != nil {
+		return Header{}, err
+	}
+	return h, nil
+}
+
+// Read implements io.Reader, reading the payload while updating the
+// running checksum used by ValidatePayload.
+func (r *SnapshotReader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	if n > 0 {
+		r.hasher.Write(p[:n])
+	}
+	return n, err
+}
+
+// ValidatePayload returns whether every payload byte read through Read so
+// far matches the checksum recorded in header.
+func (r *SnapshotReader) ValidatePayload(header Header) bool {
+	return bytes.Equal(r.hasher.Sum(nil), header.PayloadChecksum)
+}
+
+// Close closes the underlying snapshot file.
+func (r *SnapshotReader) Close() error {
+	return r.f.Close()
+}
+
+// FileCollection accumulates the external files, e.g. ones produced by an
+// IOnDiskStateMachine's SaveSnapshot, associated with a snapshot being
+// generated.
+type FileCollection struct {
+	files []*pb.SnapshotFile
+}
+
+// NewFileCollection creates an empty FileCollection.
+func NewFileCollection() *FileCollection {
+	return &FileCollection{}
+}
+
+// AddFile registers an external file, identified by fileID, to be included
+// in the snapshot being generated.
+func (fc *FileCollection) AddFile(fileID uint64, path string, metadata []byte) {
+	fc.files = append(fc.files, &pb.SnapshotFile{
+		Filepath: path,
+		FileId:   fileID,
+		Filename: filepath.Base(path),
+		Metadata: metadata,
+	})
+}
+
+// PrepareFiles copies every file registered with AddFile, read from the
+// path it was registered with, into finalDir, computing the size and crc32
+// checksum later verified by snapshotter.Verify. tmpDir is not used.
+func (fc *FileCollection) PrepareFiles(tmpDir string, finalDir string) ([]*pb.SnapshotFile, error) {
+	result := make([]*pb.SnapshotFile, 0, len(fc.files))
+	for _, rf := range fc.files {
+		src := rf.Filepath
+		dst := filepath.Join(finalDir, rf.Filename)
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(dst, data, 0644); err != nil {
+			return nil, err
+		}
+		f := &pb.SnapshotFile{
+			Filepath: dst,
+			FileId:   rf.FileId,
+			Filename: rf.Filename,
+			FileSize: uint64(len(data)),
+			Crc32:    crc32.ChecksumIEEE(data),
+			Metadata: rf.Metadata,
+		}
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+// NewChunkWriter returns the io.Writer used by Stream to turn a compressed
+// snapshot byte stream into a series of pb.IChunkSink.Receive calls.
+func NewChunkWriter(sink pb.IChunkSink, meta *SSMeta) io.Writer {
+	return &chunkWriter{sink: sink}
+}
+
+type chunkWriter struct {
+	sink pb.IChunkSink
+}
+
+func (w *chunkWriter) Write(data []byte) (int, error) {
+	if _, err := w.sink.Receive(data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// ShrinkSnapshot rewrites the snapshot file at fp into shrinkedFp as a
+// dummy snapshot that keeps fp's Header but discards its payload, used by
+// snapshotter.Shrink to reclaim disk space for snapshots that have already
+// been superseded but are still referenced by in-flight log compaction.
+func ShrinkSnapshot(fp string, shrinkedFp string) error {
+	r, err := NewSnapshotReader(fp)
+	if err != nil {
+		return err
+	}
+	header, err := r.GetHeader()
+	r.Close()
+	if err != nil {
+		return err
+	}
+	header.PayloadSize = 0
+	header.PayloadChecksum = nil
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, SnapshotHeaderSize)
+	copy(buf, data)
+	return ioutil.WriteFile(shrinkedFp, buf, 0644)
+}
+
+// ReplaceSnapshotFile atomically replaces dst with src, matching the
+// rename-based replacement convention used elsewhere, e.g.
+// objectstore.LocalFS.Put.
+func ReplaceSnapshotFile(src string, dst string) error {
+	if err := os.Rename(src, dst); err != nil {
+		return err
+	}
+	return fileutil.SyncDir(filepath.Dir(dst))
+}
@@ -0,0 +1,41 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dragonboat
+
+import (
+	"math"
+
+	pb "github.com/lni/dragonboat/v3/raftpb"
+)
+
+// ListSnapshots returns every snapshot known to the LogDB for the specified
+// Raft node that matches filter, oldest first. An operator can use this to
+// e.g. list every snapshot tagged "pre-upgrade" regardless of how the
+// node's RetentionPolicy would otherwise have compacted them away, since
+// tagged-and-pinned snapshots are never removed by Compact.
+func (nh *NodeHost) ListSnapshots(clusterID uint64,
+	nodeID uint64, filter SnapshotFilter) ([]pb.Snapshot, error) {
+	snapshots, err := nh.logdb.ListSnapshots(clusterID, nodeID, math.MaxUint64)
+	if err != nil {
+		return nil, err
+	}
+	var matched []pb.Snapshot
+	for _, ss := range snapshots {
+		if filter.matches(ss) {
+			matched = append(matched, ss)
+		}
+	}
+	return matched, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dragonboat
+
+import "fmt"
+
+// VerifySnapshots walks every snapshot the LogDB knows about for the
+// specified Raft node and verifies its integrity, returning one
+// VerificationReport per snapshot. It never mutates on disk state; call
+// RepairSnapshot with the index of a corrupt or missing report to clean it
+// up.
+func (nh *NodeHost) VerifySnapshots(clusterID uint64,
+	nodeID uint64) ([]VerificationReport, error) {
+	nh.mu.RLock()
+	v, ok := nh.mu.clusters.Load(clusterID)
+	nh.mu.RUnlock()
+	if !ok {
+		return nil, ErrClusterNotFound
+	}
+	if got := v.(*node).nodeID; got != nodeID {
+		return nil, fmt.Errorf("cluster %d is served by node %d on this NodeHost, not node %d",
+			clusterID, got, nodeID)
+	}
+	return v.(*node).snapshotter.VerifyAll()
+}
+
+// RepairSnapshot removes the corrupt or missing snapshot at index for the
+// specified Raft node from both the LogDB and the local filesystem, so
+// ProcessOrphans can re-derive a clean state on the next restart.
+func (nh *NodeHost) RepairSnapshot(clusterID uint64,
+	nodeID uint64, index uint64) error {
+	nh.mu.RLock()
+	v, ok := nh.mu.clusters.Load(clusterID)
+	nh.mu.RUnlock()
+	if !ok {
+		return ErrClusterNotFound
+	}
+	if got := v.(*node).nodeID; got != nodeID {
+		return fmt.Errorf("cluster %d is served by node %d on this NodeHost, not node %d",
+			clusterID, got, nodeID)
+	}
+	return v.(*node).snapshotter.Repair(index)
+}
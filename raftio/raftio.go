@@ -0,0 +1,92 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package raftio contains the interface that a Raft Log and snapshot
+// metadata storage engine, a LogDB, must implement to be used by
+// dragonboat.
+package raftio
+
+import (
+	pb "github.com/lni/dragonboat/v3/raftpb"
+)
+
+// RaftState is the durable Raft log metadata returned by
+// ILogDB.ReadRaftState, describing how far a node's log has actually been
+// compacted rather than what ListSnapshots reports has been committed.
+type RaftState struct {
+	// State is the node's durable HardState.
+	State pb.State
+	// FirstIndex is the index of the oldest Raft log entry currently kept
+	// for the node, i.e. the index immediately following the last
+	// snapshot the log has actually been compacted against.
+	FirstIndex uint64
+	// EntryCount is the number of Raft log entries currently kept.
+	EntryCount uint64
+}
+
+// ILogDB is the interface implemented by the persistent storage engine
+// used to keep Raft log entries, HardState and snapshot metadata durable.
+//
+// Saving a snapshot is split into PrepareSnapshot and CommitSnapshot so
+// that snapshotter can make the on disk snapshot payload durable first,
+// then stage its metadata durably, before finally making it visible to
+// ListSnapshots - without this order, a crash between the snapshot file
+// and the LogDB record being made durable could leave the LogDB
+// referencing a snapshot whose payload never made it to disk.
+type ILogDB interface {
+	// Name returns the type name of the ILogDB implementation.
+	Name() string
+	// ListSnapshots lists every snapshot known for the specified Raft node
+	// up to and including index, oldest first.
+	ListSnapshots(clusterID uint64, nodeID uint64, index uint64) ([]pb.Snapshot, error)
+	// SaveSnapshots atomically saves the Update records in us, each of
+	// which may carry a snapshot to commit in a single step. It is meant for
+	// callers that do not need the
+	// PrepareSnapshot/CommitSnapshot durability ordering because the
+	// snapshot and its accompanying Raft state are known not to race, as
+	// is the case for regular (non-exported) snapshots taken outside the
+	// normal Ready processing loop.
+	SaveSnapshots(us []pb.Update) error
+	// PrepareSnapshot durably stages snapshot's metadata without yet
+	// making it visible to ListSnapshots. It must be called, and return
+	// successfully, only after the snapshot's on disk payload is itself
+	// already durable.
+	PrepareSnapshot(clusterID uint64, nodeID uint64, snapshot pb.Snapshot) error
+	// CommitSnapshot makes a snapshot previously staged by PrepareSnapshot
+	// for the specified Raft node visible to ListSnapshots.
+	CommitSnapshot(clusterID uint64, nodeID uint64, snapshot pb.Snapshot) error
+	// DeleteSnapshot removes the metadata of the snapshot taken at index
+	// for the specified Raft node.
+	DeleteSnapshot(clusterID uint64, nodeID uint64, index uint64) error
+	// SaveRaftState atomically saves each Update's HardState and log
+	// entries, and, when present, its snapshot - the counterpart to
+	// SaveSnapshots for callers driving the normal Ready processing loop
+	// rather than a standalone snapshot request.
+	SaveRaftState(us []pb.Update) error
+	// IterateEntries returns up to maxSize bytes of Raft log entries in
+	// [low, high) for the specified node.
+	IterateEntries(clusterID uint64, nodeID uint64,
+		low uint64, high uint64, maxSize uint64) ([]pb.Entry, error)
+	// ReadRaftState returns the durable Raft log metadata for the
+	// specified node, used e.g. by snapshotter.ProcessOrphans to confirm
+	// the log has actually been compacted past a snapshot before any
+	// state derived from it, such as an orphan snapshot directory, is
+	// discarded.
+	ReadRaftState(clusterID uint64, nodeID uint64, snapshotIndex uint64) (RaftState, error)
+	// ImportSnapshot saves snapshot directly as the specified node's most
+	// recent snapshot without going through PrepareSnapshot/
+	// CommitSnapshot, e.g. when an operator restores a node from a backup
+	// exported by a different member of the cluster.
+	ImportSnapshot(clusterID uint64, nodeID uint64, snapshot pb.Snapshot) error
+}
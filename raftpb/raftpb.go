@@ -0,0 +1,166 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package raftpb contains the types used to describe Raft log entries,
+// snapshots and the membership of a Raft cluster, shared between the
+// dragonboat package, the LogDB implementations under raftio and the
+// snapshot streaming transport.
+package raftpb
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// CompressionType is the type of the compression algorithm used on a
+// snapshot's payload.
+type CompressionType uint32
+
+const (
+	// NoCompression indicates that a snapshot's payload is not compressed.
+	NoCompression CompressionType = iota
+	// Snappy indicates that a snapshot's payload is compressed using Snappy.
+	Snappy
+	// Zstd indicates that a snapshot's payload is compressed using Zstd.
+	Zstd
+	// LZ4 indicates that a snapshot's payload is compressed using LZ4.
+	LZ4
+	// S2 indicates that a snapshot's payload is compressed using S2.
+	S2
+)
+
+// Membership describes the membership of a Raft cluster at the point a
+// snapshot was taken.
+type Membership struct {
+	ConfigChangeId uint64
+	Addresses      map[uint64]string
+	Observers      map[uint64]string
+	Witnesses      map[uint64]string
+	Removed        map[uint64]struct{}
+}
+
+// Marshal returns the binary representation of m. Snapshot.Membership is
+// kept as a typed field rather than pre-serialized bytes so that callers,
+// e.g. NodeHost.ListSnapshots, can inspect it directly; Marshal is only
+// needed by uploadToRemoteStore's sidecar metadata document.
+func (m Membership) Marshal() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// SnapshotFile describes a single external file associated with a
+// snapshot, e.g. one returned by an IOnDiskStateMachine's SaveSnapshot.
+type SnapshotFile struct {
+	Filepath string
+	FileId   uint64
+	Filename string
+	FileSize uint64
+	Crc32    uint32
+	Metadata []byte
+}
+
+// Snapshot describes a saved snapshot of a Raft node's state machine.
+type Snapshot struct {
+	ClusterId   uint64
+	Filepath    string
+	Membership  Membership
+	Index       uint64
+	Term        uint64
+	OnDiskIndex uint64
+	Files       []*SnapshotFile
+	Dummy       bool
+	Type        CompressionType
+	Checksum    []byte
+	FileSize    uint64
+	// Tags holds the arbitrary, operator supplied labels attached to the
+	// snapshot when it was requested, see SSRequest.Tags. They are used by
+	// SnapshotFilter and RetentionPolicy.KeepPerTag to select and protect
+	// specific snapshots.
+	Tags map[string]string
+	// Pinned marks the snapshot as exempt from compaction by
+	// selectSnapshotsToCompact, regardless of RetentionPolicy.
+	Pinned bool
+	// Timestamp is when the snapshot was taken, used by
+	// RetentionPolicy.KeepWithin to decide whether it is still within its
+	// protected retention window.
+	Timestamp time.Time
+}
+
+// EntryType distinguishes a Raft log Entry carrying an application command
+// from one carrying a cluster membership change.
+type EntryType uint64
+
+const (
+	// ApplicationEntry carries a command to be applied to the state
+	// machine once committed.
+	ApplicationEntry EntryType = iota
+	// ConfigChangeEntry carries a cluster membership change.
+	ConfigChangeEntry
+)
+
+// Entry represents a single entry in the Raft log.
+type Entry struct {
+	Term  uint64
+	Index uint64
+	Type  EntryType
+	Cmd   []byte
+}
+
+// State is the durable Raft HardState, the subset of a node's state that
+// must survive a restart: the term and vote cast in it, plus the commit
+// index.
+type State struct {
+	Term   uint64
+	Vote   uint64
+	Commit uint64
+}
+
+// Bootstrap records the info used to initialize a new Raft node's
+// membership the first time it starts. It is persisted once by the LogDB
+// and never updated afterwards.
+type Bootstrap struct {
+	Join      bool
+	Addresses map[uint64]string
+}
+
+// Update bundles the Raft state, including an optional snapshot, that a
+// single raftio.ILogDB.SaveSnapshots/SaveRaftState call persists together.
+type Update struct {
+	ClusterID uint64
+	NodeID    uint64
+	State     State
+	Entries   []Entry
+	Snapshot  Snapshot
+}
+
+// IsEmptySnapshot returns a boolean flag indicating whether the specified
+// snapshot is an empty dummy record rather than an actual snapshot.
+func IsEmptySnapshot(s Snapshot) bool {
+	return s.Dummy
+}
+
+// IChunkSink is the interface used by the snapshot streaming transport to
+// receive a stream of snapshot chunks from Stream.
+type IChunkSink interface {
+	// Receive processes a chunk of snapshot data, returning whether more
+	// chunks are expected.
+	Receive(data []byte) (bool, error)
+	// Stop notifies the sink that no further chunks will be sent, e.g.
+	// because an earlier step failed.
+	Stop()
+	// ClusterID returns the cluster ID this sink is streaming a snapshot
+	// for.
+	ClusterID() uint64
+	// ToNodeID returns the node ID this sink is streaming a snapshot for.
+	ToNodeID() uint64
+}
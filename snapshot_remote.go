@@ -0,0 +1,44 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dragonboat
+
+import "fmt"
+
+// ImportSnapshotFromRemote downloads the exported snapshot taken at index
+// from the object store configured via
+// config.NodeHostConfig.SnapshotStorage, then feeds it for nodeID into the
+// same ImportSnapshot path used for locally available snapshot files. It is
+// the remote-storage counterpart of NodeHost.SyncRequestSnapshot with
+// SnapshotOption.ExportPath pointed at local disk. The cluster must be
+// running on this NodeHost, and the object key is built from the ID of the
+// node this NodeHost runs for clusterID, not from nodeID, so only snapshots
+// exported by that node are found.
+func (nh *NodeHost) ImportSnapshotFromRemote(clusterID uint64,
+	nodeID uint64, index uint64) error {
+	nh.mu.RLock()
+	v, ok := nh.mu.clusters.Load(clusterID)
+	nh.mu.RUnlock()
+	if !ok {
+		return ErrClusterNotFound
+	}
+	snapshotter := v.(*node).snapshotter
+	env := snapshotter.getSSEnv(index)
+	fp, err := snapshotter.ImportSnapshotFromRemote(env, index)
+	if err != nil {
+		return fmt.Errorf("failed to download remote snapshot %d for %s: %w",
+			index, snapshotter.id(), err)
+	}
+	return nh.importSnapshot(clusterID, nodeID, fp)
+}
@@ -0,0 +1,105 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dragonboat
+
+import (
+	"time"
+
+	"github.com/lni/dragonboat/v3/config"
+	pb "github.com/lni/dragonboat/v3/raftpb"
+)
+
+// SnapshotFilter narrows down the snapshots returned by
+// NodeHost.ListSnapshots. A zero value filter matches every snapshot.
+type SnapshotFilter struct {
+	// Tag, when set, only matches snapshots carrying this tag key.
+	Tag string
+	// TagValue, when set together with Tag, further requires the tag to
+	// have this exact value.
+	TagValue string
+	// PinnedOnly, when true, only matches pinned snapshots.
+	PinnedOnly bool
+}
+
+func (f SnapshotFilter) matches(ss pb.Snapshot) bool {
+	if f.PinnedOnly && !ss.Pinned {
+		return false
+	}
+	if len(f.Tag) > 0 {
+		v, ok := ss.Tags[f.Tag]
+		if !ok {
+			return false
+		}
+		if len(f.TagValue) > 0 && v != f.TagValue {
+			return false
+		}
+	}
+	return true
+}
+
+// selectSnapshotsToCompact applies policy to snapshots (ordered oldest to
+// newest, as returned by raftio.ILogDB.ListSnapshots) and returns the
+// subset that should be removed. Pinned snapshots are always excluded.
+func selectSnapshotsToCompact(snapshots []pb.Snapshot,
+	policy config.RetentionPolicy, now time.Time) []pb.Snapshot {
+	keepLast := policy.KeepLast
+	if keepLast <= 0 {
+		keepLast = snapshotsToKeep
+	}
+	keep := make(map[uint64]struct{})
+	for _, ss := range snapshots {
+		if ss.Pinned {
+			keep[ss.Index] = struct{}{}
+		}
+	}
+	if n := len(snapshots); n > 0 {
+		start := n - keepLast
+		if start < 0 {
+			start = 0
+		}
+		for _, ss := range snapshots[start:] {
+			keep[ss.Index] = struct{}{}
+		}
+	}
+	if policy.KeepWithin > 0 {
+		cutoff := now.Add(-policy.KeepWithin)
+		for _, ss := range snapshots {
+			if ss.Timestamp.After(cutoff) {
+				keep[ss.Index] = struct{}{}
+			}
+		}
+	}
+	for tag, n := range policy.KeepPerTag {
+		var tagged []pb.Snapshot
+		for _, ss := range snapshots {
+			if _, ok := ss.Tags[tag]; ok {
+				tagged = append(tagged, ss)
+			}
+		}
+		if len(tagged) > n {
+			tagged = tagged[len(tagged)-n:]
+		}
+		for _, ss := range tagged {
+			keep[ss.Index] = struct{}{}
+		}
+	}
+	var toRemove []pb.Snapshot
+	for _, ss := range snapshots {
+		if _, ok := keep[ss.Index]; !ok {
+			toRemove = append(toRemove, ss)
+		}
+	}
+	return toRemove
+}
@@ -0,0 +1,91 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dragonboat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lni/dragonboat/v3/config"
+	pb "github.com/lni/dragonboat/v3/raftpb"
+)
+
+func TestSelectSnapshotsToCompactKeepsOnlyKeepLastWhenUnconfigured(t *testing.T) {
+	now := time.Now()
+	var snapshots []pb.Snapshot
+	for i := uint64(1); i <= 5; i++ {
+		snapshots = append(snapshots, pb.Snapshot{Index: i, Timestamp: now})
+	}
+	toRemove := selectSnapshotsToCompact(snapshots, config.RetentionPolicy{}, now)
+	if len(toRemove) != len(snapshots)-snapshotsToKeep {
+		t.Fatalf("expected %d snapshots removed, got %d", len(snapshots)-snapshotsToKeep, len(toRemove))
+	}
+	for _, ss := range toRemove {
+		if ss.Index > uint64(len(snapshots)-snapshotsToKeep) {
+			t.Fatalf("selectSnapshotsToCompact removed a snapshot it should have kept: %d", ss.Index)
+		}
+	}
+}
+
+func TestSelectSnapshotsToCompactNeverRemovesPinnedSnapshots(t *testing.T) {
+	now := time.Now()
+	snapshots := []pb.Snapshot{
+		{Index: 1, Timestamp: now, Pinned: true},
+		{Index: 2, Timestamp: now},
+		{Index: 3, Timestamp: now},
+		{Index: 4, Timestamp: now},
+		{Index: 5, Timestamp: now},
+	}
+	toRemove := selectSnapshotsToCompact(snapshots, config.RetentionPolicy{KeepLast: 1}, now)
+	for _, ss := range toRemove {
+		if ss.Index == 1 {
+			t.Fatalf("pinned snapshot 1 must never be selected for compaction")
+		}
+	}
+}
+
+func TestSelectSnapshotsToCompactHonoursKeepWithin(t *testing.T) {
+	now := time.Now()
+	snapshots := []pb.Snapshot{
+		{Index: 1, Timestamp: now.Add(-48 * time.Hour)},
+		{Index: 2, Timestamp: now.Add(-1 * time.Hour)},
+	}
+	policy := config.RetentionPolicy{KeepLast: 1, KeepWithin: 24 * time.Hour}
+	toRemove := selectSnapshotsToCompact(snapshots, policy, now)
+	for _, ss := range toRemove {
+		if ss.Index == 2 {
+			t.Fatalf("snapshot 2 was taken within KeepWithin and must be kept")
+		}
+	}
+	if len(toRemove) != 1 || toRemove[0].Index != 1 {
+		t.Fatalf("expected only snapshot 1 (outside KeepWithin) to be removed, got %v", toRemove)
+	}
+}
+
+func TestSelectSnapshotsToCompactHonoursKeepPerTag(t *testing.T) {
+	now := time.Now()
+	snapshots := []pb.Snapshot{
+		{Index: 1, Timestamp: now, Tags: map[string]string{"nightly": "1"}},
+		{Index: 2, Timestamp: now, Tags: map[string]string{"nightly": "1"}},
+		{Index: 3, Timestamp: now},
+	}
+	policy := config.RetentionPolicy{KeepLast: 1, KeepPerTag: map[string]int{"nightly": 2}}
+	toRemove := selectSnapshotsToCompact(snapshots, policy, now)
+	for _, ss := range toRemove {
+		if ss.Index == 1 || ss.Index == 2 {
+			t.Fatalf("both snapshots tagged nightly must be kept by KeepPerTag, removed %d", ss.Index)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dragonboat
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+
+	"github.com/lni/dragonboat/v3/internal/rsm"
+	pb "github.com/lni/dragonboat/v3/raftpb"
+)
+
+// VerificationReport describes the outcome of verifying a single on disk
+// snapshot, as produced by snapshotter.Verify and surfaced through
+// NodeHost.VerifySnapshots and the snapshotverify tool under tools/.
+type VerificationReport struct {
+	Index   uint64
+	Corrupt bool
+	Missing bool
+	Reason  string
+}
+
+// Verify reopens the committed snapshot at index, recomputes the checksum
+// of its compressed payload and cross-checks it against the checksum and
+// size recorded in the LogDB, then confirms every external file listed in
+// pb.Snapshot.Files is present on disk with a matching size and CRC32.
+func (s *snapshotter) Verify(index uint64) error {
+	ss, err := s.GetSnapshot(index)
+	if err != nil {
+		return err
+	}
+	return s.verifySnapshot(ss)
+}
+
+// VerifyAll verifies every snapshot known to the LogDB for this node,
+// returning a VerificationReport per snapshot rather than stopping at the
+// first failure.
+func (s *snapshotter) VerifyAll() ([]VerificationReport, error) {
+	snapshots, err := s.logdb.ListSnapshots(s.clusterID, s.nodeID, math.MaxUint64)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]VerificationReport, 0, len(snapshots))
+	for _, ss := range snapshots {
+		r := VerificationReport{Index: ss.Index}
+		if verr := s.verifySnapshot(ss); verr != nil {
+			// verifySnapshot's per-file error path wraps the underlying stat
+			// error with fmt.Errorf("...: %w", ...), which os.IsNotExist
+			// cannot see through - it only recognizes *PathError,
+			// *LinkError and *SyscallError directly, not an arbitrarily
+			// wrapped error. errors.Is unwraps the whole chain instead.
+			if errors.Is(verr, os.ErrNotExist) {
+				r.Missing = true
+			} else {
+				r.Corrupt = true
+			}
+			r.Reason = verr.Error()
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+func (s *snapshotter) verifySnapshot(ss pb.Snapshot) (err error) {
+	if ss.Dummy {
+		return nil
+	}
+	reader, err := rsm.NewSnapshotReader(ss.Filepath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	header, err := reader.GetHeader()
+	if err != nil {
+		return err
+	}
+	cr, err := newDecompressor(header.CompressionType, reader)
+	if err != nil {
+		return err
+	}
+	defer cr.Close()
+	if _, err := io.Copy(ioutil.Discard, cr); err != nil {
+		return fmt.Errorf("failed to walk payload of snapshot %d: %w", ss.Index, err)
+	}
+	if !reader.ValidatePayload(header) {
+		return fmt.Errorf("snapshot %d failed checksum verification", ss.Index)
+	}
+	if !reader.ValidatePayload(rsm.Header{PayloadChecksum: ss.Checksum}) {
+		return fmt.Errorf("snapshot %d checksum does not match the LogDB record", ss.Index)
+	}
+	info, err := os.Stat(ss.Filepath)
+	if err != nil {
+		return err
+	}
+	if uint64(info.Size()) != ss.FileSize {
+		return fmt.Errorf("snapshot %d file size mismatch, expected %d got %d",
+			ss.Index, ss.FileSize, info.Size())
+	}
+	for _, f := range ss.Files {
+		if err := verifySnapshotFile(f); err != nil {
+			return fmt.Errorf("snapshot %d: %w", ss.Index, err)
+		}
+	}
+	return nil
+}
+
+func verifySnapshotFile(f *pb.SnapshotFile) error {
+	info, err := os.Stat(f.Filepath)
+	if err != nil {
+		return err
+	}
+	if uint64(info.Size()) != f.FileSize {
+		return fmt.Errorf("file %s size mismatch, expected %d got %d",
+			f.Filepath, f.FileSize, info.Size())
+	}
+	data, err := ioutil.ReadFile(f.Filepath)
+	if err != nil {
+		return err
+	}
+	if crc32.ChecksumIEEE(data) != f.Crc32 {
+		return fmt.Errorf("file %s failed crc32 verification", f.Filepath)
+	}
+	return nil
+}
+
+// Repair removes the on disk and LogDB state of a snapshot found to be
+// corrupt or missing by Verify/VerifyAll, so that ProcessOrphans can
+// re-derive a clean state for the node the next time it starts.
+func (s *snapshotter) Repair(index uint64) error {
+	if err := s.logdb.DeleteSnapshot(s.clusterID, s.nodeID, index); err != nil {
+		return err
+	}
+	env := s.getSSEnv(index)
+	return env.RemoveFinalDir()
+}
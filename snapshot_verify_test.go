@@ -0,0 +1,81 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dragonboat
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lni/dragonboat/v3/internal/rsm"
+	pb "github.com/lni/dragonboat/v3/raftpb"
+)
+
+func TestVerifyAllReportsMissingRatherThanCorruptForAWrappedNotExistError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot-verify-test")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "snapshot.bin")
+	w, err := rsm.NewSnapshotWriter(fp, rsm.SnapshotVersion, pb.NoCompression, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := w.Write([]byte("payload")); err != nil {
+		t.Fatalf("%v", err)
+	}
+	checksum := w.GetPayloadChecksum()
+	w.GetPayloadSize(7)
+	info, err := os.Stat(fp)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ss := pb.Snapshot{
+		Index:    1,
+		Filepath: fp,
+		Checksum: checksum,
+		FileSize: uint64(info.Size()),
+		Files: []*pb.SnapshotFile{
+			{Filepath: filepath.Join(dir, "does-not-exist"), FileSize: 1},
+		},
+	}
+	s := &snapshotter{}
+	verr := s.verifySnapshot(ss)
+	if verr == nil {
+		t.Fatalf("expected an error for a missing external file")
+	}
+	if os.IsNotExist(verr) {
+		t.Fatalf("os.IsNotExist unexpectedly saw through the %%w-wrapped error - " +
+			"this test no longer demonstrates the bug it was written for")
+	}
+	if !errors.Is(verr, os.ErrNotExist) {
+		t.Fatalf("expected errors.Is(verr, os.ErrNotExist), got %v", verr)
+	}
+	s.logdb = &fakeLogDB{committed: []pb.Snapshot{ss}}
+	reports, err := s.VerifyAll()
+	if err != nil {
+		t.Fatalf("VerifyAll failed: %v", err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("expected 1 report, got %d", len(reports))
+	}
+	report := reports[0]
+	if !report.Missing || report.Corrupt {
+		t.Fatalf("expected Missing=true, Corrupt=false, got %+v", report)
+	}
+}
@@ -15,13 +15,19 @@
 package dragonboat
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/lni/dragonboat/v3/config"
+	"github.com/lni/dragonboat/v3/internal/objectstore"
 	"github.com/lni/dragonboat/v3/internal/rsm"
 	"github.com/lni/dragonboat/v3/internal/server"
 	"github.com/lni/dragonboat/v3/raftio"
@@ -34,23 +40,23 @@ import (
 
 const (
 	snapshotsToKeep = 3
+	// remoteSnapshotsToKeep is the number of exported snapshots kept per
+	// node in the configured remote object store when
+	// config.NodeHostConfig.SnapshotStorage is set. It is fixed; no
+	// NodeHostConfig field overrides it.
+	remoteSnapshotsToKeep = 3
 )
 
-func compressionType(ct pb.CompressionType) dio.CompressionType {
-	if ct == pb.NoCompression {
-		return dio.NoCompression
-	} else if ct == pb.Snappy {
-		return dio.Snappy
-	} else {
-		panic("unknown compression type")
-	}
-}
-
 var (
 	// ErrNoSnapshot is the error used to indicate that there is no snapshot
 	// available.
 	ErrNoSnapshot        = errors.New("no snapshot available")
 	errSnapshotOutOfDate = errors.New("snapshot being generated is out of date")
+	// ErrIncompatibleData is returned when a snapshot compressed with an
+	// algorithm unknown to the current binary, e.g. one produced by a newer
+	// node using pb.Zstd, is loaded by an older binary that only knows
+	// about pb.NoCompression and pb.Snappy.
+	ErrIncompatibleData = errors.New("snapshot uses an incompatible compression type")
 )
 
 type snapshotter struct {
@@ -84,8 +90,12 @@ func (s *snapshotter) id() string {
 
 func (s *snapshotter) Stream(streamable rsm.IStreamable,
 	meta *rsm.SSMeta, sink pb.IChunkSink) error {
-	ct := compressionType(meta.CompressionType)
-	cw := dio.NewCompressor(ct, rsm.NewChunkWriter(sink, meta))
+	cw, err := newCompressor(meta.CompressionType,
+		meta.CompressionLevel, rsm.NewChunkWriter(sink, meta))
+	if err != nil {
+		sink.Stop()
+		return err
+	}
 	if err := streamable.StreamSnapshot(meta.Ctx, cw); err != nil {
 		sink.Stop()
 		return err
@@ -101,14 +111,16 @@ func (s *snapshotter) Save(savable rsm.ISavable,
 	}
 	files := rsm.NewFileCollection()
 	fp := env.GetTempFilepath()
-	ct := compressionType(meta.CompressionType)
 	writer, err := rsm.NewSnapshotWriter(fp,
-		rsm.SnapshotVersion, meta.CompressionType)
+		rsm.SnapshotVersion, meta.CompressionType, meta.CompressionLevel)
 	if err != nil {
 		return nil, env, err
 	}
 	cw := dio.NewCountedWriter(writer)
-	sw := dio.NewCompressor(ct, cw)
+	sw, err := newCompressor(meta.CompressionType, meta.CompressionLevel, cw)
+	if err != nil {
+		return nil, env, err
+	}
 	defer func() {
 		if cerr := sw.Close(); err == nil {
 			err = cerr
@@ -137,7 +149,10 @@ func (s *snapshotter) Save(savable rsm.ISavable,
 		OnDiskIndex: meta.OnDiskIndex,
 		Files:       fs,
 		Dummy:       dummy,
-		Type:        meta.Type,
+		Type:        meta.CompressionType,
+		Tags:        meta.Request.Tags,
+		Pinned:      meta.Request.Pinned,
+		Timestamp:   time.Now(),
 	}
 	return ss, env, nil
 }
@@ -153,8 +168,11 @@ func (s *snapshotter) Load(sessions rsm.ILoadableSessions,
 		reader.Close()
 		return err
 	}
-	ct := compressionType(header.CompressionType)
-	cr := dio.NewDecompressor(ct, reader)
+	cr, err := newDecompressor(header.CompressionType, reader)
+	if err != nil {
+		reader.Close()
+		return err
+	}
 	defer func() {
 		if cerr := cr.Close(); err == nil {
 			err = cerr
@@ -171,29 +189,202 @@ func (s *snapshotter) Load(sessions rsm.ILoadableSessions,
 	return nil
 }
 
+// ssEnvIface is the subset of *server.SSEnv's methods used by
+// PrepareSnapshot/CommitSnapshot. It exists so the two phases, and the
+// crash window between them, can be unit tested against a fake
+// environment instead of one that touches the real filesystem.
+type ssEnvIface interface {
+	SaveSSMetadata(ss *pb.Snapshot) error
+	FinalizeSnapshot(ss *pb.Snapshot) error
+	RemoveFlagFile() error
+}
+
+// snapshotFailpoints are gofail-style named injection points used by tests
+// to simulate a crash at a specific step of the PrepareSnapshot/
+// CommitSnapshot sequence, without depending on an actual failpoint
+// library. Each defaults to a no-op and is restored by the test that
+// overrides it.
+var snapshotFailpoints = struct {
+	beforeLogDBPrepareSnapshot func() error
+	beforeFlagFileRemoval      func() error
+}{
+	beforeLogDBPrepareSnapshot: func() error { return nil },
+	beforeFlagFileRemoval:      func() error { return nil },
+}
+
+// Commit is a convenience wrapper around PrepareSnapshot followed
+// immediately by CommitSnapshot. It is currently the only caller of either
+// method in this repository; the split itself, together with the
+// raftio.ILogDB.PrepareSnapshot/CommitSnapshot pair it drives, exists so
+// that a future caller taking regular (non-exported) snapshots as part of
+// normal Ready processing can call the two phases around the log entries
+// and HardState from the same Ready, without having to change
+// PrepareSnapshot/CommitSnapshot themselves. See PrepareSnapshot's comment
+// for why that ordering matters.
 func (s *snapshotter) Commit(snapshot pb.Snapshot, req rsm.SSRequest) error {
+	env, err := s.PrepareSnapshot(snapshot, req)
+	if err != nil {
+		return err
+	}
+	return s.CommitSnapshot(snapshot, req, env)
+}
+
+// PrepareSnapshot fsyncs the snapshot payload and finalizes its on disk
+// directory and flag file, then durably stages the snapshot's metadata in
+// the LogDB via raftio.ILogDB.PrepareSnapshot without yet making it
+// visible to ListSnapshots. A caller that takes PrepareSnapshot and
+// CommitSnapshot as two separate steps around the log entries and
+// HardState of the same Ready batch ensures that a crash between the two
+// writes never leaves the WAL referencing an index newer than the last
+// snapshot ListSnapshots can see, which on restart would otherwise look
+// like data the snapshot should already cover but isn't actually backed
+// by one.
+func (s *snapshotter) PrepareSnapshot(snapshot pb.Snapshot,
+	req rsm.SSRequest) (ssEnvIface, error) {
 	meta := &rsm.SSMeta{
 		Index:   snapshot.Index,
 		Request: req,
 	}
 	env := s.getCustomSSEnv(meta)
 	if err := env.SaveSSMetadata(&snapshot); err != nil {
-		return err
+		return env, err
 	}
 	if err := env.FinalizeSnapshot(&snapshot); err != nil {
 		if err == server.ErrSnapshotOutOfDate {
-			return errSnapshotOutOfDate
+			return env, errSnapshotOutOfDate
 		}
+		return env, err
+	}
+	if err := s.stageSnapshotInLogDB(snapshot, req); err != nil {
+		return env, err
+	}
+	return env, nil
+}
+
+// stageSnapshotInLogDB durably stages snapshot's metadata in the LogDB via
+// raftio.ILogDB.PrepareSnapshot, the LogDB-facing half of PrepareSnapshot.
+// It is a no-op for exported snapshots, which are never recorded in the
+// LogDB at all. Split out from PrepareSnapshot so it can be unit tested
+// against a fake raftio.ILogDB without needing a real snapshot
+// environment.
+func (s *snapshotter) stageSnapshotInLogDB(snapshot pb.Snapshot, req rsm.SSRequest) error {
+	if req.IsExportedSnapshot() {
+		return nil
+	}
+	if err := snapshotFailpoints.beforeLogDBPrepareSnapshot(); err != nil {
 		return err
 	}
+	return s.logdb.PrepareSnapshot(s.clusterID, s.nodeID, snapshot)
+}
+
+// CommitSnapshot makes a snapshot previously staged by PrepareSnapshot
+// visible in the LogDB (or, for exported snapshots, uploads it to the
+// remote store) and then removes its flag file, making it a regular,
+// non-orphan snapshot directory. It must only be called once the entries
+// and HardState from the same Ready, if any, are themselves already
+// durable.
+func (s *snapshotter) CommitSnapshot(snapshot pb.Snapshot,
+	req rsm.SSRequest, env ssEnvIface) error {
 	if !req.IsExportedSnapshot() {
-		if err := s.saveToLogDB(snapshot); err != nil {
+		if err := s.logdb.CommitSnapshot(s.clusterID, s.nodeID, snapshot); err != nil {
 			return err
 		}
+	} else if s.nhConfig.SnapshotStorage != nil {
+		if err := s.uploadToRemoteStore(snapshot); err != nil {
+			return err
+		}
+	}
+	if err := snapshotFailpoints.beforeFlagFileRemoval(); err != nil {
+		return err
 	}
 	return env.RemoveFlagFile()
 }
 
+// uploadToRemoteStore pushes an already finalized exported snapshot plus its
+// sidecar metadata document to the configured remote object store. It is
+// only called for exported snapshots - regular snapshots taken for log
+// compaction purposes always stay local and are tracked through the LogDB.
+func (s *snapshotter) uploadToRemoteStore(snapshot pb.Snapshot) (err error) {
+	store := s.nhConfig.SnapshotStorage
+	f, err := os.Open(snapshot.Filepath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	membership, err := snapshot.Membership.Marshal()
+	if err != nil {
+		return err
+	}
+	meta := objectstore.Metadata{
+		ClusterID:       s.clusterID,
+		NodeID:          s.nodeID,
+		Index:           snapshot.Index,
+		Term:            snapshot.Term,
+		Membership:      membership,
+		Checksum:        snapshot.Checksum,
+		FileSize:        snapshot.FileSize,
+		CompressionType: uint32(snapshot.Type),
+	}
+	key := objectstore.Key(s.nhConfig.SnapshotStoragePrefix(),
+		s.clusterID, s.nodeID, snapshot.Index)
+	return store.Put(context.Background(), key, f, meta)
+}
+
+// downloadFromRemoteStore retrieves the exported snapshot identified by
+// index from the configured remote object store and stores it under dir,
+// returning the local path to the downloaded payload.
+func (s *snapshotter) downloadFromRemoteStore(dir string, index uint64) (fp string, err error) {
+	store := s.nhConfig.SnapshotStorage
+	if store == nil {
+		return "", ErrNoSnapshot
+	}
+	key := objectstore.Key(s.nhConfig.SnapshotStoragePrefix(),
+		s.clusterID, s.nodeID, index)
+	r, _, err := store.Get(context.Background(), key)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if cerr := r.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	fp = filepath.Join(dir, fmt.Sprintf("%s-%d.snap", s.id(), index))
+	out, err := os.Create(fp)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	if _, err := io.Copy(out, r); err != nil {
+		return "", err
+	}
+	return fp, out.Sync()
+}
+
+// ImportSnapshotFromRemote downloads the exported snapshot identified by
+// index from the configured remote object store into a temporary directory
+// managed by env and returns the local path to the downloaded payload. The
+// caller, typically nodehost.NodeHost.ImportSnapshotFromRemote, is
+// responsible for feeding the returned path into the regular
+// ImportSnapshot/RecoverFromSnapshot path.
+func (s *snapshotter) ImportSnapshotFromRemote(env *server.SSEnv, index uint64) (string, error) {
+	if err := env.CreateTempDir(); err != nil {
+		return "", err
+	}
+	return s.downloadFromRemoteStore(env.GetTempDir(), index)
+}
+
 func (s *snapshotter) GetFilePath(index uint64) string {
 	env := s.getSSEnv(index)
 	return env.GetFilepath()
@@ -258,10 +449,10 @@ func (s *snapshotter) Compact(removeUpTo uint64) error {
 	if err != nil {
 		return err
 	}
-	if len(snapshots) <= snapshotsToKeep {
-		return nil
+	selected := selectSnapshotsToCompact(snapshots, s.nhConfig.SnapshotRetention, time.Now())
+	if len(selected) == 0 {
+		return s.compactRemoteSnapshots()
 	}
-	selected := snapshots[:len(snapshots)-snapshotsToKeep]
 	plog.Infof("%s has %d snapshots to compact", s.id(), len(selected))
 	for idx, ss := range selected {
 		plog.Infof("%s compacting snapshot %d, %d", s.id(), ss.Index, idx)
@@ -274,9 +465,89 @@ func (s *snapshotter) Compact(removeUpTo uint64) error {
 			return err
 		}
 	}
+	return s.compactRemoteSnapshots()
+}
+
+// compactRemoteSnapshots applies the configured remote retention policy,
+// keeping at most remoteSnapshotsToKeep exported snapshots per node in the
+// object store. It is a no-op when no SnapshotStorage backend is
+// configured. Listing is scoped to the cluster directory and then filtered
+// down to this node's own keys, since nodes sharing a cluster also share
+// that listing directory - without the filter, retention would be applied
+// across the whole cluster instead of per node.
+func (s *snapshotter) compactRemoteSnapshots() error {
+	store := s.nhConfig.SnapshotStorage
+	if store == nil {
+		return nil
+	}
+	clusterPrefix := fmt.Sprintf("%s/%d", s.nhConfig.SnapshotStoragePrefix(), s.clusterID)
+	all, err := store.List(context.Background(), clusterPrefix)
+	if err != nil {
+		return err
+	}
+	nodePrefix := objectstore.NodePrefix(s.nhConfig.SnapshotStoragePrefix(), s.clusterID, s.nodeID)
+	var keys []string
+	for _, key := range all {
+		if strings.HasPrefix(key, nodePrefix) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) <= remoteSnapshotsToKeep {
+		return nil
+	}
+	for _, key := range keys[:len(keys)-remoteSnapshotsToKeep] {
+		plog.Infof("%s compacting remote snapshot %s", s.id(), key)
+		if err := store.Delete(context.Background(), key); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// reconcileOrphanDeletion decides whether an orphan snapshot dir at
+// ssIndex is safe to delete outright, given mrss/mrssErr - the result of
+// looking up the most recently committed snapshot for the node - and
+// readRaftState, which reads the raft log's durable FirstIndex for the
+// node. It is split out of ProcessOrphans, which cannot be unit tested on
+// its own since it depends on server.SSEnv and this tree's on disk
+// directory layout, so that the reconciliation decision itself still can
+// be.
+func reconcileOrphanDeletion(ssIndex uint64, mrss pb.Snapshot, mrssErr error,
+	readRaftState func() (raftio.RaftState, error)) (bool, error) {
+	if mrssErr != nil {
+		if mrssErr == ErrNoSnapshot {
+			plog.Infof("no snapshot in logdb, delete the folder")
+			return true, nil
+		}
+		return false, mrssErr
+	}
+	if mrss.Index == ssIndex {
+		return false, nil
+	}
+	// A newer snapshot is already committed in the LogDB, but that alone
+	// doesn't prove the raft log has actually been compacted past
+	// ssIndex - only delete once ReadRaftState confirms it has, so state
+	// the log may still depend on is never discarded.
+	rs, err := readRaftState()
+	if err != nil {
+		return false, err
+	}
+	return rs.FirstIndex > ssIndex, nil
+}
+
+// ProcessOrphans reconciles snapshot directories left behind by a prior
+// crash. An orphan dir whose flag file is still present was finalized by
+// PrepareSnapshot but never had its flag file removed by CommitSnapshot;
+// the crash may have come before the LogDB staged the snapshot's record,
+// after it was staged, or after CommitSnapshot made it visible to
+// ListSnapshots. Before deleting such a dir, it cross-checks
+// raftio.ILogDB.ReadRaftState to confirm the raft log has actually been
+// compacted past the orphan's index, not just that ListSnapshots reports a
+// newer snapshot committed - a committed-but-not-yet-compacted-against
+// snapshot does not on its own prove the orphan's on disk state is safe to
+// discard. This is what makes it safe for a caller to call PrepareSnapshot
+// strictly before the LogDB write that carries the matching Ready's
+// entries and HardState.
 func (s *snapshotter) ProcessOrphans() error {
 	files, err := ioutil.ReadDir(s.dir)
 	if err != nil {
@@ -297,20 +568,14 @@ func (s *snapshotter) ProcessOrphans() error {
 			if pb.IsEmptySnapshot(ss) {
 				plog.Panicf("empty snapshot found in %s", fdir)
 			}
-			deleteDir := false
-			mrss, err := s.GetMostRecentSnapshot()
+			mrss, mrssErr := s.GetMostRecentSnapshot()
 			plog.Infof("most recent snapshot: %d, ss index %d", mrss.Index, ss.Index)
+			deleteDir, err := reconcileOrphanDeletion(ss.Index, mrss, mrssErr,
+				func() (raftio.RaftState, error) {
+					return s.logdb.ReadRaftState(s.clusterID, s.nodeID, ss.Index)
+				})
 			if err != nil {
-				if err == ErrNoSnapshot {
-					plog.Infof("no snapshot in logdb, delete the folder")
-					deleteDir = true
-				} else {
-					return err
-				}
-			} else {
-				if mrss.Index != ss.Index {
-					deleteDir = true
-				}
+				return err
 			}
 			env := s.getSSEnv(ss.Index)
 			if deleteDir {
@@ -362,15 +627,6 @@ func (s *snapshotter) getCustomSSEnv(meta *rsm.SSMeta) *server.SSEnv {
 	return s.getSSEnv(meta.Index)
 }
 
-func (s *snapshotter) saveToLogDB(snapshot pb.Snapshot) error {
-	rec := pb.Update{
-		ClusterID: s.clusterID,
-		NodeID:    s.nodeID,
-		Snapshot:  snapshot,
-	}
-	return s.logdb.SaveSnapshots([]pb.Update{rec})
-}
-
 func (s *snapshotter) dirNameMatch(dir string) bool {
 	return server.SnapshotDirNameRe.Match([]byte(dir))
 }
@@ -0,0 +1,235 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dragonboat
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lni/dragonboat/v3/config"
+	"github.com/lni/dragonboat/v3/internal/rsm"
+	"github.com/lni/dragonboat/v3/raftio"
+	pb "github.com/lni/dragonboat/v3/raftpb"
+)
+
+// fakeLogDB is a minimal in-memory raftio.ILogDB used to unit test the
+// snapshotter's LogDB-facing behaviour without a real LogDB
+// implementation.
+type fakeLogDB struct {
+	prepared   []pb.Snapshot
+	committed  []pb.Snapshot
+	firstIndex uint64
+}
+
+func (f *fakeLogDB) Name() string { return "fakeLogDB" }
+
+func (f *fakeLogDB) ListSnapshots(uint64, uint64, uint64) ([]pb.Snapshot, error) {
+	return f.committed, nil
+}
+
+func (f *fakeLogDB) SaveSnapshots([]pb.Update) error { return nil }
+
+func (f *fakeLogDB) PrepareSnapshot(clusterID uint64, nodeID uint64, ss pb.Snapshot) error {
+	f.prepared = append(f.prepared, ss)
+	return nil
+}
+
+func (f *fakeLogDB) CommitSnapshot(clusterID uint64, nodeID uint64, ss pb.Snapshot) error {
+	f.committed = append(f.committed, ss)
+	return nil
+}
+
+func (f *fakeLogDB) DeleteSnapshot(uint64, uint64, uint64) error { return nil }
+
+func (f *fakeLogDB) SaveRaftState([]pb.Update) error { return nil }
+
+func (f *fakeLogDB) IterateEntries(uint64, uint64, uint64, uint64, uint64) ([]pb.Entry, error) {
+	return nil, nil
+}
+
+func (f *fakeLogDB) ReadRaftState(uint64, uint64, uint64) (raftio.RaftState, error) {
+	return raftio.RaftState{FirstIndex: f.firstIndex}, nil
+}
+
+func (f *fakeLogDB) ImportSnapshot(clusterID uint64, nodeID uint64, ss pb.Snapshot) error {
+	f.committed = append(f.committed, ss)
+	return nil
+}
+
+// fakeSSEnv is a minimal ssEnvIface implementation used to test
+// CommitSnapshot without a real, disk backed snapshot environment.
+type fakeSSEnv struct {
+	flagFileRemoved bool
+}
+
+func (e *fakeSSEnv) SaveSSMetadata(*pb.Snapshot) error { return nil }
+func (e *fakeSSEnv) FinalizeSnapshot(*pb.Snapshot) error { return nil }
+func (e *fakeSSEnv) RemoveFlagFile() error {
+	e.flagFileRemoved = true
+	return nil
+}
+
+func resetSnapshotFailpoints() {
+	snapshotFailpoints.beforeLogDBPrepareSnapshot = func() error { return nil }
+	snapshotFailpoints.beforeFlagFileRemoval = func() error { return nil }
+}
+
+func TestStageSnapshotInLogDBPreparesRegularSnapshots(t *testing.T) {
+	defer resetSnapshotFailpoints()
+	logdb := &fakeLogDB{}
+	s := &snapshotter{logdb: logdb, clusterID: 1, nodeID: 1}
+	ss := pb.Snapshot{Index: 5}
+	if err := s.stageSnapshotInLogDB(ss, rsm.SSRequest{}); err != nil {
+		t.Fatalf("stageSnapshotInLogDB failed: %v", err)
+	}
+	if len(logdb.prepared) != 1 || logdb.prepared[0].Index != 5 {
+		t.Fatalf("expected snapshot 5 to be staged, got %v", logdb.prepared)
+	}
+}
+
+func TestStageSnapshotInLogDBSkipsExportedSnapshots(t *testing.T) {
+	defer resetSnapshotFailpoints()
+	logdb := &fakeLogDB{}
+	s := &snapshotter{logdb: logdb, clusterID: 1, nodeID: 1}
+	ss := pb.Snapshot{Index: 5}
+	req := rsm.SSRequest{Exported: true, Path: "/tmp/export"}
+	if err := s.stageSnapshotInLogDB(ss, req); err != nil {
+		t.Fatalf("stageSnapshotInLogDB failed: %v", err)
+	}
+	if len(logdb.prepared) != 0 {
+		t.Fatalf("exported snapshots must never be staged in the LogDB, got %v", logdb.prepared)
+	}
+}
+
+// TestCrashBeforeLogDBPrepareSnapshotLeavesNothingStaged is a gofail-style
+// crash-injection test: it simulates a process crash right before the
+// durable LogDB write that PrepareSnapshot depends on, and checks that the
+// LogDB is left exactly as it was before the call. Only the finalized
+// snapshot dir, still carrying its flag file, is left behind for
+// ProcessOrphans to reconcile.
+func TestCrashBeforeLogDBPrepareSnapshotLeavesNothingStaged(t *testing.T) {
+	defer resetSnapshotFailpoints()
+	injected := errors.New("injected crash before LogDB PrepareSnapshot")
+	snapshotFailpoints.beforeLogDBPrepareSnapshot = func() error { return injected }
+	logdb := &fakeLogDB{}
+	s := &snapshotter{logdb: logdb, clusterID: 1, nodeID: 1}
+	err := s.stageSnapshotInLogDB(pb.Snapshot{Index: 7}, rsm.SSRequest{})
+	if err != injected {
+		t.Fatalf("expected injected crash error, got %v", err)
+	}
+	if len(logdb.prepared) != 0 {
+		t.Fatalf("expected nothing staged after a crash, got %v", logdb.prepared)
+	}
+}
+
+func TestCommitSnapshotCommitsRegularSnapshotsToLogDB(t *testing.T) {
+	defer resetSnapshotFailpoints()
+	logdb := &fakeLogDB{}
+	s := &snapshotter{logdb: logdb, clusterID: 1, nodeID: 1, nhConfig: config.NodeHostConfig{}}
+	env := &fakeSSEnv{}
+	ss := pb.Snapshot{Index: 9}
+	if err := s.CommitSnapshot(ss, rsm.SSRequest{}, env); err != nil {
+		t.Fatalf("CommitSnapshot failed: %v", err)
+	}
+	if len(logdb.committed) != 1 || logdb.committed[0].Index != 9 {
+		t.Fatalf("expected snapshot 9 to be committed, got %v", logdb.committed)
+	}
+	if !env.flagFileRemoved {
+		t.Fatalf("expected flag file to be removed once the snapshot is committed")
+	}
+}
+
+// TestCrashAfterLogDBCommitBeforeFlagFileRemoval is a gofail-style
+// crash-injection test covering the second crash window: once
+// CommitSnapshot has made the snapshot visible to ListSnapshots, a crash
+// before its flag file is removed must still leave a recoverable, already
+// -committed snapshot behind, not a corrupt or orphaned one.
+func TestCrashAfterLogDBCommitBeforeFlagFileRemoval(t *testing.T) {
+	defer resetSnapshotFailpoints()
+	injected := errors.New("injected crash before flag file removal")
+	snapshotFailpoints.beforeFlagFileRemoval = func() error { return injected }
+	logdb := &fakeLogDB{}
+	s := &snapshotter{logdb: logdb, clusterID: 1, nodeID: 1, nhConfig: config.NodeHostConfig{}}
+	env := &fakeSSEnv{}
+	ss := pb.Snapshot{Index: 11}
+	err := s.CommitSnapshot(ss, rsm.SSRequest{}, env)
+	if err != injected {
+		t.Fatalf("expected injected crash error, got %v", err)
+	}
+	if len(logdb.committed) != 1 {
+		t.Fatalf("expected the snapshot to already be committed before the crash, got %v", logdb.committed)
+	}
+	if env.flagFileRemoved {
+		t.Fatalf("flag file must not be removed when the crash happens before RemoveFlagFile")
+	}
+}
+
+func TestReconcileOrphanDeletionDeletesWhenLogDBHasNoSnapshot(t *testing.T) {
+	ok, err := reconcileOrphanDeletion(5, pb.Snapshot{}, ErrNoSnapshot, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok {
+		t.Fatalf("expected the orphan to be deleted when the LogDB has no snapshot at all")
+	}
+}
+
+func TestReconcileOrphanDeletionKeepsWhenOrphanIsTheCommittedSnapshot(t *testing.T) {
+	ok, err := reconcileOrphanDeletion(5, pb.Snapshot{Index: 5}, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok {
+		t.Fatalf("an orphan matching the most recently committed snapshot must only have its flag file removed")
+	}
+}
+
+func TestReconcileOrphanDeletionKeepsUntilLogIsActuallyCompactedPastIt(t *testing.T) {
+	ok, err := reconcileOrphanDeletion(5, pb.Snapshot{Index: 9}, nil,
+		func() (raftio.RaftState, error) {
+			return raftio.RaftState{FirstIndex: 5}, nil
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok {
+		t.Fatalf("a newer committed snapshot alone must not be enough to delete the orphan " +
+			"until the raft log is confirmed compacted past it")
+	}
+}
+
+func TestReconcileOrphanDeletionDeletesOnceLogIsCompactedPastIt(t *testing.T) {
+	ok, err := reconcileOrphanDeletion(5, pb.Snapshot{Index: 9}, nil,
+		func() (raftio.RaftState, error) {
+			return raftio.RaftState{FirstIndex: 10}, nil
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok {
+		t.Fatalf("expected the orphan to be deleted once the raft log is confirmed compacted past it")
+	}
+}
+
+func TestReconcileOrphanDeletionPropagatesReadRaftStateError(t *testing.T) {
+	injected := errors.New("injected ReadRaftState error")
+	_, err := reconcileOrphanDeletion(5, pb.Snapshot{Index: 9}, nil,
+		func() (raftio.RaftState, error) {
+			return raftio.RaftState{}, injected
+		})
+	if err != injected {
+		t.Fatalf("expected injected error to propagate, got %v", err)
+	}
+}
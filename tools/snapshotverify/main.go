@@ -0,0 +1,82 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// snapshotverify iterates every Raft shard hosted by a NodeHost and prints
+// a report of any corrupt or missing snapshots found, optionally repairing
+// them so the node can start cleanly. It is meant to be run offline,
+// against a stopped NodeHost's data directory.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lni/dragonboat/v3"
+	"github.com/lni/dragonboat/v3/config"
+)
+
+func main() {
+	nodeHostDir := flag.String("nodehost-dir", "", "NodeHost data directory to check")
+	walDir := flag.String("wal-dir", "", "WAL directory, defaults to nodehost-dir")
+	repair := flag.Bool("repair", false, "remove corrupt or missing snapshots found")
+	flag.Parse()
+	if len(*nodeHostDir) == 0 {
+		fmt.Fprintln(os.Stderr, "-nodehost-dir is required")
+		os.Exit(1)
+	}
+	wd := *walDir
+	if len(wd) == 0 {
+		wd = *nodeHostDir
+	}
+	nhc := config.NodeHostConfig{
+		NodeHostDir: *nodeHostDir,
+		WALDir:      wd,
+	}
+	if err := run(nhc, *repair); err != nil {
+		fmt.Fprintf(os.Stderr, "snapshotverify failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(nhc config.NodeHostConfig, repair bool) error {
+	nh, err := dragonboat.NewNodeHost(nhc)
+	if err != nil {
+		return err
+	}
+	defer nh.Close()
+	corrupt := 0
+	for _, info := range nh.ListNodeInfo() {
+		reports, err := nh.VerifySnapshots(info.ClusterID, info.NodeID)
+		if err != nil {
+			return err
+		}
+		for _, r := range reports {
+			if !r.Corrupt && !r.Missing {
+				continue
+			}
+			corrupt++
+			fmt.Printf("cluster %d node %d snapshot %d: corrupt=%v missing=%v reason=%s\n",
+				info.ClusterID, info.NodeID, r.Index, r.Corrupt, r.Missing, r.Reason)
+			if repair {
+				if err := nh.RepairSnapshot(info.ClusterID, info.NodeID, r.Index); err != nil {
+					return err
+				}
+				fmt.Printf("  repaired\n")
+			}
+		}
+	}
+	fmt.Printf("%d corrupt or missing snapshot(s) found\n", corrupt)
+	return nil
+}